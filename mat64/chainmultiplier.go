@@ -0,0 +1,130 @@
+// Copyright ©2015 The gonum Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mat64
+
+import "sync"
+
+// ChainMultiplier compiles the operation order for a chain of factors
+// with a fixed sequence of dimensions once, and reuses that plan, its
+// working stack, and a workspace pool private to itself across many
+// calls to Multiply.
+//
+// ChainMultiplier targets iterative solvers, EM and Kalman filter
+// updates, and other code that repeatedly multiplies a same-shaped
+// chain of matrices; each call to Dense.Product redoes the chain
+// ordering optimization and reallocates its table, stack and onStack
+// slices from scratch, which dominates when the factors themselves are
+// cheap to multiply relative to the chain length.
+//
+// A ChainMultiplier is not safe for concurrent use by multiple
+// goroutines; construct one per goroutine that needs to multiply the
+// chain.
+type ChainMultiplier struct {
+	dims  []int
+	table table
+
+	stack   []*Dense
+	onStack []bool
+
+	pool workspacePool
+}
+
+// NewChainMultiplier returns a ChainMultiplier that computes and caches
+// the operation order for a chain of len(dims)-1 factors whose
+// successive dimensions are given by dims; dims[i] is the row count of
+// factor i and, for i>0, the column count of factor i-1. The returned
+// ChainMultiplier can be reused for any sequence of factors sharing
+// this dimension chain, for example as the underlying factor matrices
+// are updated between iterations of a solver.
+func NewChainMultiplier(dims []int) *ChainMultiplier {
+	if len(dims) < 2 {
+		panic(ErrShape)
+	}
+	n := len(dims) - 1
+	c := &ChainMultiplier{
+		dims:    dims,
+		table:   newTable(n),
+		onStack: make([]bool, n),
+	}
+	if n > 2 {
+		p := &multiplier{dims: dims, table: c.table}
+		p.optimizeDP()
+	}
+	return c
+}
+
+// Multiply calculates the product of factors, whose dimensions must
+// match the chain dims passed to NewChainMultiplier, and places the
+// result in dst. It reuses the operation order computed by
+// NewChainMultiplier and the workspace pool private to c, rather than
+// recomputing them as Dense.Product does.
+func (c *ChainMultiplier) Multiply(dst *Dense, factors ...Matrix) {
+	n := len(c.dims) - 1
+	if len(factors) != n {
+		panic(ErrShape)
+	}
+
+	switch n {
+	case 1:
+		dst.reuseAs(factors[0].Dims())
+		dst.Copy(factors[0])
+		return
+	case 2:
+		dst.Mul(factors[0], factors[1])
+		return
+	}
+
+	for i := range c.onStack {
+		c.onStack[i] = false
+	}
+	p := &multiplier{
+		factors: factors,
+		dims:    c.dims,
+		table:   c.table,
+		onStack: c.onStack,
+		stack:   c.stack[:0],
+		pool:    &c.pool,
+	}
+	result := p.multiply()
+	c.stack = p.stack[:0]
+
+	dst.reuseAs(result.Dims())
+	dst.Copy(result)
+	p.putWorkspace(result)
+}
+
+// workspacePool is a pool of reusable *Dense workspace matrices scoped
+// to a single owner, mirroring the shape of the package-level
+// getWorkspace/putWorkspace pool without contending with it or with
+// other owners' pools.
+type workspacePool struct {
+	mu   sync.Mutex
+	free map[[2]int][]*Dense
+}
+
+func (wp *workspacePool) get(r, c int) *Dense {
+	key := [2]int{r, c}
+	wp.mu.Lock()
+	var m *Dense
+	if free := wp.free[key]; len(free) > 0 {
+		m, wp.free[key] = free[len(free)-1], free[:len(free)-1]
+	}
+	wp.mu.Unlock()
+	if m == nil {
+		m = NewDense(r, c, nil)
+	}
+	return m
+}
+
+func (wp *workspacePool) put(m *Dense) {
+	r, c := m.Dims()
+	key := [2]int{r, c}
+	wp.mu.Lock()
+	if wp.free == nil {
+		wp.free = make(map[[2]int][]*Dense)
+	}
+	wp.free[key] = append(wp.free[key], m)
+	wp.mu.Unlock()
+}
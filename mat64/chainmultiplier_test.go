@@ -0,0 +1,39 @@
+// Copyright ©2015 The gonum Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mat64
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestChainMultiplier checks that repeated calls to Multiply on a single
+// ChainMultiplier, with different factor matrices sharing the compiled
+// dimension chain, agree with what Dense.Product computes from scratch.
+func TestChainMultiplier(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	dims := []int{4, 6, 3, 5, 2, 7}
+	cm := NewChainMultiplier(dims)
+
+	for trial := 0; trial < 5; trial++ {
+		factors := make([]Matrix, len(dims)-1)
+		for i := range factors {
+			r, c := dims[i], dims[i+1]
+			data := make([]float64, r*c)
+			for k := range data {
+				data[k] = rnd.Float64()
+			}
+			factors[i] = NewDense(r, c, data)
+		}
+
+		var got, want Dense
+		cm.Multiply(&got, factors...)
+		want.Product(factors...)
+
+		if !EqualApprox(&got, &want, 1e-12) {
+			t.Errorf("trial %d: ChainMultiplier.Multiply does not match Product", trial)
+		}
+	}
+}
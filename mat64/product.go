@@ -11,42 +11,32 @@ import "fmt"
 // the number of floating point operations on the basis that all matrix
 // multiplications are general.
 func (m *Dense) Product(factors ...Matrix) {
-	// The operation order optimisation is the naive O(n^3) dynamic
-	// programming approach and does not take into consideration
-	// finer-grained optimisations that might be available.
-	//
-	// TODO(kortschak) Consider using the O(nlogn) or O(mlogn)
-	// algorithms that are available. e.g.
-	//
-	// e.g. http://www.jofcis.com/publishedpapers/2014_10_10_4299_4306.pdf
-	//
-	// In the case that this is replaced, retain this code in
-	// tests to compare against.
+	m.ProductWithOptions(ProductOptions{}, factors...)
+}
 
-	r, c := m.Dims()
+// productFastPath handles the 0, 1 and 2 factor cases that are cheap
+// enough not to need the chain ordering optimizer at all, placing the
+// result in m and reporting whether it did so. Product,
+// ProductWithOptions and ProductFunc all share this fast path; callers
+// that get false back still need to build a multiplier for the general
+// case.
+func productFastPath(m *Dense, factors []Matrix) bool {
 	switch len(factors) {
 	case 0:
+		r, c := m.Dims()
 		if r != 0 || c != 0 {
 			panic(ErrShape)
 		}
-		return
 	case 1:
 		m.reuseAs(factors[0].Dims())
 		m.Copy(factors[0])
-		return
 	case 2:
 		// Don't do work that we know the answer to.
 		m.Mul(factors[0], factors[1])
-		return
+	default:
+		return false
 	}
-
-	p := newMultiplier(m, factors)
-	p.optimize()
-	result := p.multiply()
-
-	m.reuseAs(result.Dims())
-	m.Copy(result)
-	putWorkspace(result)
+	return true
 }
 
 // debugProductWalk enables debugging output for Product.
@@ -73,6 +63,25 @@ type multiplier struct {
 	// in the input factors.
 	stack   []*Dense
 	onStack []bool
+
+	// pool is the workspace pool used for
+	// intermediate products. A nil pool
+	// uses the package-level workspace
+	// pool.
+	pool *workspacePool
+
+	// parallelCost and sem configure
+	// concurrent subtree evaluation in
+	// multiplySubchainParallel; they are
+	// unused by the serial multiplySubchain.
+	parallelCost int64
+	sem          chan struct{}
+
+	// costFn, if non-nil, overrides the
+	// dense split cost assumed by
+	// optimizeDP. See CostFunc and
+	// ProductFunc.
+	costFn CostFunc
 }
 
 func newMultiplier(m *Dense, factors []Matrix) *multiplier {
@@ -110,18 +119,23 @@ func newMultiplier(m *Dense, factors []Matrix) *multiplier {
 	}
 }
 
-// optimize determines an optimal matrix multiply operation order.
-func (p *multiplier) optimize() {
+// optimizeDP determines an optimal matrix multiply operation order
+// using an O(n³) dynamic programming table fill. This is the only
+// ordering optimizer in this package; a sub-cubic algorithm has been
+// attempted before and found to produce incorrect orderings, and no
+// verified faster replacement exists yet.
+func (p *multiplier) optimizeDP() {
 	if debugProductWalk {
 		fmt.Printf("chain dims: %v\n", p.dims)
 	}
 	const maxInt = int(^uint(0) >> 1)
-	for f := 1; f < len(p.factors); f++ {
-		for i := 0; i < len(p.factors)-f; i++ {
+	n := len(p.dims) - 1
+	for f := 1; f < n; f++ {
+		for i := 0; i < n-f; i++ {
 			j := i + f
 			p.table.set(i, j, entry{cost: maxInt})
 			for k := i; k < j; k++ {
-				cost := p.table.at(i, k).cost + p.table.at(k+1, j).cost + p.dims[i]*p.dims[k+1]*p.dims[j+1]
+				cost := p.table.at(i, k).cost + p.table.at(k+1, j).cost + p.splitCost(i, k, j)
 				if cost < p.table.at(i, j).cost {
 					p.table.set(i, j, entry{cost: cost, k: k})
 				}
@@ -130,7 +144,32 @@ func (p *multiplier) optimize() {
 	}
 }
 
-// multiply walks the optimal operation tree found by optimize,
+// splitCost returns the cost of merging the subchains [i,k] and [k+1,j]
+// at split k. It uses p.costFn, if ProductFunc provided one, or
+// otherwise the dense-operation cost p.dims[i]*p.dims[k+1]*p.dims[j+1]
+// that optimizeDP also assumes.
+//
+// A subchain only has a concrete Matrix to offer costFn when it is a
+// single leaf factor (i==k or k+1==j); a subchain spanning more than
+// one factor is an intermediate product that optimizeDP hasn't
+// actually computed yet, so there is no real Matrix for costFn to
+// inspect, and splitCost passes nil instead of the misleading
+// boundary factor.
+func (p *multiplier) splitCost(i, k, j int) int {
+	if p.costFn == nil {
+		return p.dims[i] * p.dims[k+1] * p.dims[j+1]
+	}
+	var left, right Matrix
+	if k == i {
+		left = p.factors[i]
+	}
+	if k+1 == j {
+		right = p.factors[j]
+	}
+	return p.costFn(i, k, j, left, right)
+}
+
+// multiply walks the optimal operation tree found by optimizeDP,
 // leaving the final result in the stack. It returns the
 // product, which may be copied but should be returned to
 // the workspace pool.
@@ -168,17 +207,36 @@ func (p *multiplier) multiplySubchain(i, j int) {
 			i, ar, ac, result(p.onStack[i]), j, br, bc, result(p.onStack[j]))
 	}
 
-	r := getWorkspace(ar, bc, false)
+	r := p.getWorkspace(ar, bc, false)
 	r.Mul(a, b)
 	if p.onStack[i] {
-		putWorkspace(a.(*Dense))
+		p.putWorkspace(a.(*Dense))
 	}
 	if p.onStack[j] {
-		putWorkspace(b.(*Dense))
+		p.putWorkspace(b.(*Dense))
 	}
 	p.push(r, i, j)
 }
 
+// getWorkspace returns a workspace matrix from p's pool, or from the
+// package-level workspace pool if p has none of its own.
+func (p *multiplier) getWorkspace(r, c int, clear bool) *Dense {
+	if p.pool != nil {
+		return p.pool.get(r, c)
+	}
+	return getWorkspace(r, c, clear)
+}
+
+// putWorkspace returns a workspace matrix obtained from getWorkspace to
+// the pool it came from.
+func (p *multiplier) putWorkspace(m *Dense) {
+	if p.pool != nil {
+		p.pool.put(m)
+		return
+	}
+	putWorkspace(m)
+}
+
 func (p *multiplier) push(m *Dense, i, j int) {
 	p.onStack[i] = true
 	p.onStack[j] = true
@@ -0,0 +1,43 @@
+// Copyright ©2015 The gonum Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mat64
+
+// CostFunc estimates the cost, in scalar multiplications, of merging
+// the subchains spanning factors i through k and k+1 through j at the
+// split k. left and right are factors[i] and factors[j] when the
+// corresponding subchain is just that one leaf factor (i==k or
+// k+1==j respectively), and nil otherwise: a subchain spanning more
+// than one factor is an intermediate product the optimizer hasn't
+// actually computed yet, so there is no single Matrix to offer for
+// it. A CostFunc can type-assert a non-nil left or right against a
+// structured matrix type to account for sparse, triangular, diagonal,
+// or other structure for which the true cost of an eventual
+// multiplication is lower than the dense estimate
+// rows(left)×cols(left)×cols(right) the default optimizer assumes,
+// and should fall back to that dense estimate whenever left or right
+// is nil.
+type CostFunc func(i, k, j int, left, right Matrix) int
+
+// ProductFunc calculates the product of the given factors and places
+// the result in the receiver, as Product does, but chooses the
+// parenthesization that minimizes the total cost reported by costFn
+// rather than assuming every intermediate product is dense. This lets
+// callers plug in domain-specific cost estimators, for example for
+// banded matrices whose product with a dense matrix is O(n·bandwidth)
+// rather than O(n²).
+func (m *Dense) ProductFunc(costFn CostFunc, factors ...Matrix) {
+	if done := productFastPath(m, factors); done {
+		return
+	}
+
+	p := newMultiplier(m, factors)
+	p.costFn = costFn
+	p.optimizeDP()
+	result := p.multiply()
+
+	m.reuseAs(result.Dims())
+	m.Copy(result)
+	p.putWorkspace(result)
+}
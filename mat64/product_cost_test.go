@@ -0,0 +1,104 @@
+// Copyright ©2015 The gonum Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mat64
+
+import "testing"
+
+// diagLike wraps a *Dense so a CostFunc in this test can identify it by
+// type, standing in for a real structured matrix type (a diagonal or
+// banded type, say) without one needing to exist in this package yet.
+type diagLike struct{ *Dense }
+
+func isDiagLike(m Matrix) bool {
+	_, ok := m.(diagLike)
+	return ok
+}
+
+// TestProductFuncSparseAwarePlanDiffers checks that a CostFunc treating
+// a structured operand as effectively free to multiply by can steer
+// ProductFunc's optimizer toward a different split than the
+// dense-only optimizer chooses for the same chain.
+func TestProductFuncSparseAwarePlanDiffers(t *testing.T) {
+	// B is diagLike, so a merge that actually has B as one of its two
+	// operands is free: that's true of both A*B (split k=1) and B*C
+	// (split k=0), but not of the other merge each of those splits
+	// also requires (A*(BC) still needs a real, non-free outer A merge
+	// after a free B*C; (AB)*C still needs a real, non-free outer
+	// merge after a free A*B). The dense-optimal plan splits at k=0
+	// because A*B (1000·60·59 = 3540000) is far dearer than B*C
+	// (60·59·10 = 35400), for totals of 635400 at k=0 and 4130000 at
+	// k=1. The sparse-aware plan, seeing both inner merges as free,
+	// compares only the outer merges, 1000·60·10 = 600000 at k=0
+	// against 1000·59·10 = 590000 at k=1, and takes k=1.
+	dims := []int{1000, 60, 59, 10}
+	a := NewDense(dims[0], dims[1], nil)
+	b := NewDense(dims[1], dims[2], nil)
+	c := NewDense(dims[2], dims[3], nil)
+	factors := []Matrix{a, diagLike{b}, c}
+
+	dense := &multiplier{factors: factors, dims: dims, table: newTable(3), onStack: make([]bool, 3)}
+	dense.optimizeDP()
+	denseK := dense.table.at(0, 2).k
+
+	// costFn reconstructs the dense dims[i]*dims[k+1]*dims[j+1] cost
+	// from the closed-over dims slice, but treats a merge whose left
+	// or right operand is diagLike as free, the way multiplying by a
+	// diagonal matrix effectively is next to the dense estimate. left
+	// and right are nil for a split whose adjacent subchain isn't a
+	// single leaf factor, so this only ever sees diagLike where B is
+	// genuinely one of the two matrices being merged.
+	costFn := func(i, k, j int, left, right Matrix) int {
+		if isDiagLike(left) || isDiagLike(right) {
+			return 0
+		}
+		return dims[i] * dims[k+1] * dims[j+1]
+	}
+
+	sparse := &multiplier{factors: factors, dims: dims, table: newTable(3), onStack: make([]bool, 3), costFn: costFn}
+	sparse.optimizeDP()
+	sparseK := sparse.table.at(0, 2).k
+
+	if sparseK == denseK {
+		t.Fatalf("expected sparse-aware plan to differ from dense-optimal plan, both chose split k=%d", denseK)
+	}
+}
+
+// TestSplitCostLeafOperands checks that splitCost only ever passes a
+// concrete operand to a CostFunc when the adjacent subchain is a
+// single leaf factor, and passes nil for subchains spanning more than
+// one factor. TestProductFuncSparseAwarePlanDiffers touches a
+// multi-factor subchain too, but only asserts that the chosen plans
+// differ, not that the operands costFn saw were actually correct for
+// it; this test asserts that directly, across several split points.
+func TestSplitCostLeafOperands(t *testing.T) {
+	dims := []int{2, 3, 4, 5, 6}
+	factors := make([]Matrix, len(dims)-1)
+	for i := range factors {
+		factors[i] = NewDense(dims[i], dims[i+1], nil)
+	}
+
+	var sawMultiFactorSplit bool
+	costFn := func(i, k, j int, left, right Matrix) int {
+		wantLeft := k == i
+		wantRight := k+1 == j
+		if !wantLeft || !wantRight {
+			sawMultiFactorSplit = true
+		}
+		if (left != nil) != wantLeft {
+			t.Errorf("split(i=%d,k=%d,j=%d): left operand present=%v, want=%v", i, k, j, left != nil, wantLeft)
+		}
+		if (right != nil) != wantRight {
+			t.Errorf("split(i=%d,k=%d,j=%d): right operand present=%v, want=%v", i, k, j, right != nil, wantRight)
+		}
+		return dims[i] * dims[k+1] * dims[j+1]
+	}
+
+	p := &multiplier{factors: factors, dims: dims, table: newTable(len(factors)), onStack: make([]bool, len(factors)), costFn: costFn}
+	p.optimizeDP()
+
+	if !sawMultiFactorSplit {
+		t.Fatal("test chain too short to exercise a multi-factor subchain")
+	}
+}
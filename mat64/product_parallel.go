@@ -0,0 +1,121 @@
+// Copyright ©2015 The gonum Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mat64
+
+import "sync"
+
+// DefaultParallelCost is the ParallelCost used by ProductWithOptions
+// when ProductOptions.ParallelCost is zero.
+const DefaultParallelCost = 1e6
+
+// ProductOptions controls the concurrency used by Dense.ProductWithOptions.
+type ProductOptions struct {
+	// Workers is the maximum number of goroutines used to evaluate
+	// independent subtrees of the chain's operation order
+	// concurrently. Workers <= 1 disables concurrency, making
+	// ProductWithOptions equivalent to Product.
+	Workers int
+
+	// ParallelCost is the minimum scalar-multiplication cost, as
+	// estimated by the chain ordering optimizer, that both subtrees
+	// of a split must exceed before they are evaluated on separate
+	// goroutines. Splits below this threshold are evaluated on the
+	// calling goroutine to avoid the overhead of spawning goroutines
+	// for small workloads. A zero ParallelCost uses DefaultParallelCost.
+	ParallelCost int64
+}
+
+// ProductWithOptions calculates the product of the given factors and places
+// the result in the receiver, as Product does, but evaluates independent
+// subtrees of the chosen operation order concurrently according to opts.
+func (m *Dense) ProductWithOptions(opts ProductOptions, factors ...Matrix) {
+	if done := productFastPath(m, factors); done {
+		return
+	}
+
+	p := newMultiplier(m, factors)
+	p.optimizeDP()
+
+	var result *Dense
+	if opts.Workers > 1 {
+		cost := opts.ParallelCost
+		if cost <= 0 {
+			cost = DefaultParallelCost
+		}
+		p.parallelCost = cost
+		p.sem = make(chan struct{}, opts.Workers-1)
+		result = p.multiplySubchainParallel(0, len(p.factors)-1).(*Dense)
+	} else {
+		result = p.multiply()
+	}
+
+	m.reuseAs(result.Dims())
+	m.Copy(result)
+	p.putWorkspace(result)
+}
+
+// multiplySubchainParallel evaluates the subchain [i,j] of the operation
+// order found by optimizeDP, forking the left subtree onto its own
+// goroutine when both subtrees' cost exceeds p.parallelCost and a slot
+// in p.sem is available, and otherwise evaluating both subtrees on the
+// calling goroutine. Unlike multiplySubchain, it returns the product
+// directly instead of pushing it onto p.stack, since the stack's
+// pop-the-top-of-stack convention assumes a single-goroutine, strictly
+// post-order traversal.
+func (p *multiplier) multiplySubchainParallel(i, j int) Matrix {
+	if i == j {
+		return p.factors[i]
+	}
+
+	k := p.table.at(i, j).k
+
+	var a, b Matrix
+	if int64(p.table.at(i, k).cost) > p.parallelCost && int64(p.table.at(k+1, j).cost) > p.parallelCost && p.tryAcquire() {
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer p.release()
+			a = p.multiplySubchainParallel(i, k)
+		}()
+		b = p.multiplySubchainParallel(k+1, j)
+		wg.Wait()
+	} else {
+		a = p.multiplySubchainParallel(i, k)
+		b = p.multiplySubchainParallel(k+1, j)
+	}
+
+	ar, ac := a.Dims()
+	br, bc := b.Dims()
+	if ac != br {
+		panic(ErrShape.string)
+	}
+
+	r := p.getWorkspace(ar, bc, false)
+	r.Mul(a, b)
+	if k != i {
+		p.putWorkspace(a.(*Dense))
+	}
+	if k+1 != j {
+		p.putWorkspace(b.(*Dense))
+	}
+	return r
+}
+
+// tryAcquire reports whether a goroutine slot was available in p.sem,
+// acquiring it if so. It never blocks.
+func (p *multiplier) tryAcquire() bool {
+	select {
+	case p.sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release returns a goroutine slot acquired by tryAcquire.
+func (p *multiplier) release() {
+	<-p.sem
+}
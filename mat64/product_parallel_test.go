@@ -0,0 +1,65 @@
+// Copyright ©2015 The gonum Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mat64
+
+import (
+	"math/rand"
+	"runtime"
+	"testing"
+)
+
+// mixedChainDims holds the dimensions of a chain of 8 factors mixing a
+// few large matrices, whose products dominate the cost, with several
+// small ones, so that only some splits in the operation order clear a
+// realistic ParallelCost threshold: with DefaultParallelCost only the
+// root split, whose subtrees cost 2880000 and 3136400, is forked.
+var mixedChainDims = []int{800, 900, 4, 1000, 6, 850, 900, 5, 700}
+
+func mixedChainFactors(rnd *rand.Rand) []Matrix {
+	factors := make([]Matrix, len(mixedChainDims)-1)
+	for i := range factors {
+		r, c := mixedChainDims[i], mixedChainDims[i+1]
+		data := make([]float64, r*c)
+		for k := range data {
+			data[k] = rnd.Float64()
+		}
+		factors[i] = NewDense(r, c, data)
+	}
+	return factors
+}
+
+func TestProductWithOptionsMatchesProduct(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	factors := mixedChainFactors(rnd)
+
+	var want, got Dense
+	want.Product(factors...)
+	got.ProductWithOptions(ProductOptions{Workers: runtime.GOMAXPROCS(0)}, factors...)
+
+	if !EqualApprox(&got, &want, 1e-9) {
+		t.Error("ProductWithOptions does not match Product")
+	}
+}
+
+func BenchmarkProductMixedChainSerial(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	factors := mixedChainFactors(rnd)
+	var dst Dense
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dst.Product(factors...)
+	}
+}
+
+func BenchmarkProductMixedChainParallel(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	factors := mixedChainFactors(rnd)
+	opts := ProductOptions{Workers: runtime.GOMAXPROCS(0)}
+	var dst Dense
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dst.ProductWithOptions(opts, factors...)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright ©2015 The gonum Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mat64
+
+// Plan is a parenthesization of a chain of factors, as chosen by
+// Dense.ProductPlan. A Plan with Left and Right both nil is a leaf,
+// referring to FactorIndex directly; otherwise it is the product of
+// the two smaller plans Left and Right. Cost is the total estimated
+// scalar-multiplication cost of the plan, as determined by the
+// optimizer that produced it.
+//
+// A Plan can be inspected to see or assert the order an optimizer
+// chose, or persisted (e.g. with encoding/json or encoding/gob) and
+// later replayed with Execute against factors of the same dimensions,
+// without repeating the optimization.
+type Plan struct {
+	Left, Right *Plan
+
+	// FactorIndex is the index into the factors passed to ProductPlan
+	// this Plan refers to. It is only meaningful when Left and Right
+	// are both nil.
+	FactorIndex int
+
+	Cost int64
+}
+
+// ProductPlan determines the parenthesization Product would use to
+// multiply factors, and returns it as a Plan, without carrying out the
+// multiplication.
+func (m *Dense) ProductPlan(factors ...Matrix) (Plan, error) {
+	r, c := m.Dims()
+	switch len(factors) {
+	case 0:
+		if r != 0 || c != 0 {
+			return Plan{}, ErrShape
+		}
+		return Plan{}, nil
+	case 1:
+		return Plan{FactorIndex: 0}, nil
+	case 2:
+		fr, fc := factors[0].Dims()
+		cr, cc := factors[1].Dims()
+		if fc != cr {
+			return Plan{}, ErrShape
+		}
+		return Plan{
+			Left:  &Plan{FactorIndex: 0},
+			Right: &Plan{FactorIndex: 1},
+			Cost:  int64(fr) * int64(fc) * int64(cc),
+		}, nil
+	}
+
+	var plan Plan
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				if e, ok := r.(Error); ok {
+					err = e
+					return
+				}
+				panic(r)
+			}
+		}()
+		p := newMultiplier(m, factors)
+		p.optimizeDP()
+		plan = p.plan(0, len(factors)-1)
+		return nil
+	}()
+	if err != nil {
+		return Plan{}, err
+	}
+	return plan, nil
+}
+
+// plan builds the Plan for the subchain [i,j] from the table built by
+// optimizeDP.
+func (p *multiplier) plan(i, j int) Plan {
+	if i == j {
+		return Plan{FactorIndex: i}
+	}
+	k := p.table.at(i, j).k
+	left := p.plan(i, k)
+	right := p.plan(k+1, j)
+	return Plan{Left: &left, Right: &right, Cost: int64(p.table.at(i, j).cost)}
+}
+
+// Execute carries out the multiplication described by plan against
+// factors, which must have the same dimensions as the factors
+// Dense.ProductPlan built plan from, and places the result in dst.
+func (plan *Plan) Execute(dst *Dense, factors ...Matrix) {
+	result, owned := plan.execute(factors)
+	dst.reuseAs(result.Dims())
+	dst.Copy(result)
+	if owned {
+		putWorkspace(result.(*Dense))
+	}
+}
+
+// execute evaluates plan against factors, returning the resulting
+// matrix and whether it is an intermediate workspace matrix that the
+// caller must return with putWorkspace, as opposed to one of factors
+// itself.
+func (plan *Plan) execute(factors []Matrix) (result Matrix, owned bool) {
+	if plan.Left == nil && plan.Right == nil {
+		return factors[plan.FactorIndex], false
+	}
+
+	a, aOwned := plan.Left.execute(factors)
+	b, bOwned := plan.Right.execute(factors)
+	ar, ac := a.Dims()
+	br, bc := b.Dims()
+	if ac != br {
+		panic(ErrShape.string)
+	}
+
+	r := getWorkspace(ar, bc, false)
+	r.Mul(a, b)
+	if aOwned {
+		putWorkspace(a.(*Dense))
+	}
+	if bOwned {
+		putWorkspace(b.(*Dense))
+	}
+	return r, true
+}
@@ -0,0 +1,68 @@
+// Copyright ©2015 The gonum Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mat64
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestProductPlanClassicOrder checks that the classic three-factor
+// example A(5,6)·B(6,3)·C(3,1), for which computing BC first is
+// cheaper than computing AB first, produces the plan A(BC).
+func TestProductPlanClassicOrder(t *testing.T) {
+	a := NewDense(5, 6, nil)
+	b := NewDense(6, 3, nil)
+	c := NewDense(3, 1, nil)
+
+	var dst Dense
+	plan, err := dst.ProductPlan(a, b, c)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if plan.Left == nil || plan.Right == nil {
+		t.Fatal("expected a non-leaf plan")
+	}
+	if plan.Left.FactorIndex != 0 || plan.Left.Left != nil {
+		t.Error("expected the left branch of the plan to be the leaf A")
+	}
+	if plan.Right.Left == nil || plan.Right.Right == nil {
+		t.Fatal("expected the right branch of the plan to be BC")
+	}
+	if plan.Right.Left.FactorIndex != 1 || plan.Right.Right.FactorIndex != 2 {
+		t.Error("expected the right branch of the plan to be B(6,3)*C(3,1)")
+	}
+}
+
+// TestPlanExecuteMatchesProduct checks that replaying a Plan against
+// the factors it was built from reproduces what Product computes.
+func TestPlanExecuteMatchesProduct(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	dims := []int{4, 6, 3, 5, 2, 7}
+	factors := make([]Matrix, len(dims)-1)
+	for i := range factors {
+		r, c := dims[i], dims[i+1]
+		data := make([]float64, r*c)
+		for k := range data {
+			data[k] = rnd.Float64()
+		}
+		factors[i] = NewDense(r, c, data)
+	}
+
+	var planner Dense
+	plan, err := planner.ProductPlan(factors...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var want, got Dense
+	want.Product(factors...)
+	plan.Execute(&got, factors...)
+
+	if !EqualApprox(&got, &want, 1e-12) {
+		t.Error("Plan.Execute does not match Product")
+	}
+}